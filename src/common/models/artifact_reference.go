@@ -0,0 +1,107 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "encoding/json"
+
+// ArtifactReferenceTable is the name of the table in DB that holds the artifact_reference objects
+const ArtifactReferenceTable = "artifact_reference"
+
+// Platform describes the OS/architecture a referenced artifact targets.
+type Platform struct {
+	OS           string   `json:"os,omitempty"`
+	Architecture string   `json:"architecture,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	OSVersion    string   `json:"os_version,omitempty"`
+	OSFeatures   []string `json:"os_features,omitempty"`
+}
+
+// ArtifactReference is a row persisted alongside a manifest's blobs, recording the per-reference
+// digest/size/media type plus the Platform and Annotations of the referenced manifest or layer.
+// Access Platform/Annotations through their Get/Set methods rather than the raw JSON columns.
+type ArtifactReference struct {
+	ID              int64  `orm:"pk;auto;column(id)" json:"id"`
+	ArtifactID      int64  `orm:"column(artifact_id)" json:"artifact_id"`
+	Digest          string `orm:"column(digest)" json:"digest"`
+	MediaType       string `orm:"column(media_type)" json:"media_type"`
+	Size            int64  `orm:"column(size)" json:"size"`
+	PlatformJSON    string `orm:"column(platform_json)" json:"-"`
+	AnnotationsJSON string `orm:"column(annotations_json)" json:"-"`
+}
+
+// TableName ...
+func (r *ArtifactReference) TableName() string {
+	return ArtifactReferenceTable
+}
+
+// Platform unmarshals PlatformJSON, returning nil if the reference carries no platform.
+func (r *ArtifactReference) Platform() (*Platform, error) {
+	if r.PlatformJSON == "" {
+		return nil, nil
+	}
+
+	p := &Platform{}
+	if err := json.Unmarshal([]byte(r.PlatformJSON), p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// SetPlatform marshals p into PlatformJSON.
+func (r *ArtifactReference) SetPlatform(p *Platform) error {
+	if p == nil {
+		r.PlatformJSON = ""
+		return nil
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	r.PlatformJSON = string(b)
+	return nil
+}
+
+// Annotations unmarshals AnnotationsJSON, returning nil if the reference carries no annotations.
+func (r *ArtifactReference) Annotations() (map[string]string, error) {
+	if r.AnnotationsJSON == "" {
+		return nil, nil
+	}
+
+	m := map[string]string{}
+	if err := json.Unmarshal([]byte(r.AnnotationsJSON), &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetAnnotations marshals annotations into AnnotationsJSON.
+func (r *ArtifactReference) SetAnnotations(annotations map[string]string) error {
+	if len(annotations) == 0 {
+		r.AnnotationsJSON = ""
+		return nil
+	}
+
+	b, err := json.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+
+	r.AnnotationsJSON = string(b)
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/goharbor/harbor/src/common/utils/log"
+)
+
+const (
+	// defaultLockTTL is how long a lock is held before it must be renewed.
+	defaultLockTTL = 10 * time.Second
+	// defaultLockRetryInterval is how long to wait between acquisition attempts.
+	defaultLockRetryInterval = 100 * time.Millisecond
+	// defaultLockRetryTimeout bounds how long AcquireXxx blocks waiting on a contended lock.
+	defaultLockRetryTimeout = 10 * time.Second
+	// minLockTTL is the smallest TTL a lock is taken with: a positive Locker.TTL below it is
+	// raised to it. This keeps ttl/2, the renew-ticker period, positive (time.NewTicker panics
+	// on a non-positive duration) and the PX milliseconds sent to Redis above zero.
+	minLockTTL = 200 * time.Millisecond
+)
+
+// unlockScript releases the lock only if it's still held by the fence token that acquired it,
+// so a lock that expired and was re-acquired by someone else is never released out from under them.
+var unlockScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// renewScript extends the TTL of the lock only if it's still held by the fence token that
+// acquired it.
+var renewScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Unlock releases a lock acquired through Locker. Only the first call releases the lock; later
+// calls do nothing and return nil.
+type Unlock func() error
+
+// Locker acquires a Redis-backed distributed lock for a BlobInfo/ManifestInfo/ChartVersionInfo
+// mutex key, renewing it on a background goroutine for as long as it's held.
+type Locker struct {
+	// TTL is how long a lock is held before it must be renewed. Defaults to 10s.
+	TTL time.Duration
+	// RetryInterval is how long to wait between failed acquisition attempts. Defaults to 100ms.
+	RetryInterval time.Duration
+	// RetryTimeout bounds how long AcquireXxx blocks waiting to acquire a contended lock.
+	// Defaults to 10s.
+	RetryTimeout time.Duration
+}
+
+// NewLocker returns a Locker configured with the package defaults.
+func NewLocker() *Locker {
+	return &Locker{
+		TTL:           defaultLockTTL,
+		RetryInterval: defaultLockRetryInterval,
+		RetryTimeout:  defaultLockRetryTimeout,
+	}
+}
+
+// AcquireBlob locks the blob described by info for the duration of a quota-sensitive operation.
+func (l *Locker) AcquireBlob(info *BlobInfo) (Unlock, error) {
+	return l.acquire(info.MutexKey())
+}
+
+// AcquireManifest locks the manifest described by info for the duration of a quota-sensitive operation.
+func (l *Locker) AcquireManifest(info *ManifestInfo) (Unlock, error) {
+	return l.acquire(info.MutexKey())
+}
+
+// AcquireChart locks the chart version described by info for the duration of a quota-sensitive operation.
+func (l *Locker) AcquireChart(info *ChartVersionInfo) (Unlock, error) {
+	return l.acquire(info.MutexKey())
+}
+
+func (l *Locker) acquire(key string) (Unlock, error) {
+	ttl := l.TTL
+	switch {
+	case ttl <= 0:
+		ttl = defaultLockTTL
+	case ttl < minLockTTL:
+		ttl = minLockTTL
+	}
+	retryInterval := l.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultLockRetryInterval
+	}
+	retryTimeout := l.RetryTimeout
+	if retryTimeout <= 0 {
+		retryTimeout = defaultLockRetryTimeout
+	}
+
+	fence, err := newFenceToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %v", err)
+	}
+
+	conn, err := GetRegRedisCon()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	deadline := time.Now().Add(retryTimeout)
+	for {
+		reply, err := redis.String(conn.Do("SET", key, fence, "PX", ttl.Milliseconds(), "NX"))
+		if err == nil && reply == "OK" {
+			break
+		}
+		if err != nil && err != redis.ErrNil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to acquire lock %s: %v", key, err)
+		}
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, fmt.Errorf("timed out acquiring lock %s", key)
+		}
+		time.Sleep(retryInterval)
+	}
+
+	// The renew goroutine gets its own Redis connection: redigo's Conn is not safe for
+	// concurrent use, and unlock() below calls Do/Close on conn from whatever goroutine
+	// releases the lock, which races a renew tick firing on the same connection.
+	renewConn, err := GetRegRedisCon()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	done := make(chan struct{})
+	go renewLock(renewConn, key, fence, ttl, done)
+
+	var once sync.Once
+	unlock := func() error {
+		var unlockErr error
+		once.Do(func() {
+			close(done)
+			defer conn.Close()
+			_, unlockErr = unlockScript.Do(conn, key, fence)
+		})
+		return unlockErr
+	}
+
+	return unlock, nil
+}
+
+// renewLock periodically extends the TTL of the lock identified by (key, fence) until done is
+// closed, so a request that's still in flight never loses its lock mid-operation. It owns conn
+// exclusively and closes it on exit; callers must not touch conn again after starting this
+// goroutine.
+func renewLock(conn redis.Conn, key, fence string, ttl time.Duration, done <-chan struct{}) {
+	defer conn.Close()
+
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if _, err := renewScript.Do(conn, key, fence, ttl.Milliseconds()); err != nil {
+				log.Warningf("failed to renew lock %s, giving up: %v", key, err)
+				return
+			}
+		}
+	}
+}
+
+func newFenceToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,76 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockerAcquireBlockedUntilUnlock(t *testing.T) {
+	l := NewLocker()
+	info := &BlobInfo{ProjectID: 1, Repository: "library/photon", Digest: "sha256:" + t.Name()}
+
+	unlock, err := l.AcquireBlob(info)
+	if err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+
+	contended := &Locker{TTL: time.Second, RetryInterval: 20 * time.Millisecond, RetryTimeout: 100 * time.Millisecond}
+	_, err = contended.AcquireBlob(info)
+	assert.Error(t, err, "acquiring an already-held lock should time out")
+
+	require.NoError(t, unlock())
+
+	_, err = contended.AcquireBlob(info)
+	assert.NoError(t, err, "lock should be acquirable again once released")
+}
+
+func TestLockerRenewKeepsLockAliveAcrossTTL(t *testing.T) {
+	l := &Locker{TTL: 200 * time.Millisecond, RetryInterval: 10 * time.Millisecond, RetryTimeout: time.Second}
+	info := &ManifestInfo{ProjectID: 1, Repository: "library/photon", Tag: t.Name()}
+
+	unlock, err := l.AcquireManifest(info)
+	if err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+	defer unlock()
+
+	time.Sleep(l.TTL * 3)
+
+	contended := &Locker{TTL: time.Second, RetryInterval: 10 * time.Millisecond, RetryTimeout: 100 * time.Millisecond}
+	_, err = contended.AcquireManifest(info)
+	assert.Error(t, err, "the renew goroutine should have kept extending the TTL past its original deadline")
+}
+
+func TestLockerTTLFloorDoesNotPanic(t *testing.T) {
+	l := &Locker{TTL: time.Nanosecond, RetryInterval: 10 * time.Millisecond, RetryTimeout: time.Second}
+	info := &ChartVersionInfo{ProjectID: 1, Namespace: "library", ChartName: "wordpress", Version: t.Name()}
+
+	assert.NotPanics(t, func() {
+		unlock, err := l.AcquireChart(info)
+		if err != nil {
+			t.Skipf("redis not available: %v", err)
+		}
+		defer unlock()
+
+		// Give the renew goroutine a chance to tick at least once with the clamped TTL.
+		// The clamped TTL is minLockTTL (200ms), so the renew ticker fires every 100ms.
+		time.Sleep(150 * time.Millisecond)
+	})
+}
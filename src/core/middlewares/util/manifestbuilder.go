@@ -0,0 +1,119 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ManifestBuilder fabricates a distribution.Manifest from a config blob and a set of layer
+// descriptors, without a distribution.BlobService round-trip to the registry.
+type ManifestBuilder interface {
+	// AppendReference adds a layer to the manifest being built.
+	AppendReference(reference distribution.Describable) error
+	// Build creates the manifest from the config and references accumulated so far.
+	Build(ctx context.Context) (distribution.Manifest, error)
+}
+
+type schema2Builder struct {
+	configMediaType string
+	configJSON      []byte
+	layers          []distribution.Descriptor
+}
+
+// NewSchema2ManifestBuilder returns a ManifestBuilder that builds a Docker schema2 manifest
+// around the given config blob.
+func NewSchema2ManifestBuilder(configMediaType string, configJSON []byte) ManifestBuilder {
+	return &schema2Builder{
+		configMediaType: configMediaType,
+		configJSON:      append([]byte(nil), configJSON...),
+	}
+}
+
+// AppendReference adds a layer to the manifest.
+func (b *schema2Builder) AppendReference(reference distribution.Describable) error {
+	b.layers = append(b.layers, reference.Descriptor())
+	return nil
+}
+
+// Build builds the schema2 manifest.
+func (b *schema2Builder) Build(ctx context.Context) (distribution.Manifest, error) {
+	configDesc := distribution.Descriptor{
+		MediaType: b.configMediaType,
+		Digest:    digest.FromBytes(b.configJSON),
+		Size:      int64(len(b.configJSON)),
+	}
+
+	manifest := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    configDesc,
+		Layers:    b.layers,
+	}
+
+	deserialized, err := schema2.FromStruct(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return deserialized, nil
+}
+
+type ocischemaBuilder struct {
+	configMediaType string
+	configJSON      []byte
+	layers          []distribution.Descriptor
+}
+
+// NewOCIManifestBuilder returns a ManifestBuilder that builds an OCI image manifest around the
+// given config blob.
+func NewOCIManifestBuilder(configMediaType string, configJSON []byte) ManifestBuilder {
+	return &ocischemaBuilder{
+		configMediaType: configMediaType,
+		configJSON:      append([]byte(nil), configJSON...),
+	}
+}
+
+// AppendReference adds a layer to the manifest.
+func (b *ocischemaBuilder) AppendReference(reference distribution.Describable) error {
+	b.layers = append(b.layers, reference.Descriptor())
+	return nil
+}
+
+// Build builds the OCI image manifest.
+func (b *ocischemaBuilder) Build(ctx context.Context) (distribution.Manifest, error) {
+	configDesc := distribution.Descriptor{
+		MediaType: b.configMediaType,
+		Digest:    digest.FromBytes(b.configJSON),
+		Size:      int64(len(b.configJSON)),
+	}
+
+	manifest := ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    configDesc,
+		Layers:    b.layers,
+	}
+
+	deserialized, err := ocischema.FromStruct(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return deserialized, nil
+}
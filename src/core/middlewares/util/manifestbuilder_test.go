@@ -0,0 +1,81 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDescribable struct {
+	d distribution.Descriptor
+}
+
+func (t testDescribable) Descriptor() distribution.Descriptor {
+	return t.d
+}
+
+func TestSchema2ManifestBuilderRoundTrip(t *testing.T) {
+	configJSON := []byte(`{"architecture":"amd64"}`)
+	layer := distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromString("layer"), Size: 123}
+
+	b := NewSchema2ManifestBuilder(schema2.MediaTypeImageConfig, configJSON)
+	require.NoError(t, b.AppendReference(testDescribable{d: layer}))
+
+	manifest, err := b.Build(context.Background())
+	require.NoError(t, err)
+
+	mediaType, payload, err := manifest.Payload()
+	require.NoError(t, err)
+	assert.Equal(t, schema2.MediaTypeManifest, mediaType)
+
+	// References lists the config descriptor first, then the layers.
+	require.Len(t, manifest.References(), 2)
+	assert.Equal(t, layer.Digest, manifest.References()[1].Digest)
+
+	reparsed, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.References(), reparsed.References())
+}
+
+func TestOCIManifestBuilderRoundTrip(t *testing.T) {
+	configJSON := []byte(`{"architecture":"arm64"}`)
+	layer := distribution.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromString("layer"), Size: 456}
+
+	b := NewOCIManifestBuilder(ocispec.MediaTypeImageConfig, configJSON)
+	require.NoError(t, b.AppendReference(testDescribable{d: layer}))
+
+	manifest, err := b.Build(context.Background())
+	require.NoError(t, err)
+
+	mediaType, payload, err := manifest.Payload()
+	require.NoError(t, err)
+	assert.Equal(t, ocispec.MediaTypeImageManifest, mediaType)
+
+	// References lists the config descriptor first, then the layers.
+	require.Len(t, manifest.References(), 2)
+	assert.Equal(t, layer.Digest, manifest.References()[1].Digest)
+
+	reparsed, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.References(), reparsed.References())
+}
@@ -0,0 +1,87 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	_ "github.com/docker/distribution/manifest/ocischema" // registers the OCI manifest schema with distribution.UnmarshalManifest
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// UnmarshalManifestFunc unmarshals the raw manifest bytes of a registered media type into a
+// distribution.Manifest plus the descriptor of the manifest itself.
+type UnmarshalManifestFunc func(content []byte) (distribution.Manifest, distribution.Descriptor, error)
+
+var (
+	manifestSchemasLock sync.RWMutex
+	manifestSchemas     = make(map[string]UnmarshalManifestFunc)
+)
+
+// RegisterManifestSchema registers an UnmarshalManifestFunc for a manifest media type, looked up
+// by ParseManifestInfoFromReq from the request's Content-Type.
+func RegisterManifestSchema(mediaType string, fn UnmarshalManifestFunc) error {
+	manifestSchemasLock.Lock()
+	defer manifestSchemasLock.Unlock()
+
+	if _, exists := manifestSchemas[mediaType]; exists {
+		return fmt.Errorf("manifest schema already registered for media type %s", mediaType)
+	}
+	manifestSchemas[mediaType] = fn
+
+	return nil
+}
+
+// getManifestSchema returns the UnmarshalManifestFunc registered for mediaType.
+func getManifestSchema(mediaType string) (UnmarshalManifestFunc, error) {
+	manifestSchemasLock.RLock()
+	defer manifestSchemasLock.RUnlock()
+
+	fn, ok := manifestSchemas[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type for manifest: %s", mediaType)
+	}
+
+	return fn, nil
+}
+
+func init() {
+	// schema1, schema2 and ocischema manifests as well as manifest lists / OCI image indexes all
+	// already know how to unmarshal themselves through distribution.UnmarshalManifest - delegate
+	// to it rather than duplicating that logic here.
+	builtinMediaTypes := []string{
+		schema1.MediaTypeManifest,
+		schema1.MediaTypeSignedManifest,
+		schema2.MediaTypeManifest,
+		ocispec.MediaTypeImageManifest,
+		manifestlist.MediaTypeManifestList,
+		ocispec.MediaTypeImageIndex,
+	}
+
+	for _, mediaType := range builtinMediaTypes {
+		mt := mediaType
+		unmarshal := func(content []byte) (distribution.Manifest, distribution.Descriptor, error) {
+			return distribution.UnmarshalManifest(mt, content)
+		}
+		if err := RegisterManifestSchema(mt, unmarshal); err != nil {
+			panic(fmt.Sprintf("failed to register builtin manifest schema %s: %v", mt, err))
+		}
+	}
+}
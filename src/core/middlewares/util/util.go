@@ -29,8 +29,7 @@ import (
 	"time"
 
 	"github.com/docker/distribution"
-	"github.com/docker/distribution/manifest/schema1"
-	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/garyburd/redigo/redis"
 	"github.com/goharbor/harbor/src/common/dao"
 	"github.com/goharbor/harbor/src/common/models"
@@ -136,6 +135,11 @@ type ManifestInfo struct {
 	References []distribution.Descriptor
 	Descriptor distribution.Descriptor
 
+	// IsIndex is true when the manifest is a manifest list (application/vnd.docker.distribution.manifest.list.v2+json)
+	// or an OCI image index (application/vnd.oci.image.index.v1+json), in which case References holds the
+	// per-platform child manifests rather than layer blobs
+	IsIndex bool
+
 	// manifestExist is to index the existing of the manifest in DB by (repository, digest)
 	manifestExist     bool
 	manifestExistErr  error
@@ -175,8 +179,23 @@ func (info *ManifestInfo) BlobMutexKey(blob *models.Blob, suffix ...string) stri
 	return strings.Join(append(a, suffix...), ":")
 }
 
-// SyncBlobs sync layers of manifest to blobs
+// SyncBlobs sync layers of manifest to blobs. For a manifest list / OCI index, the references are
+// child manifests rather than blobs, so they're synced as rows in the artifact_reference table
+// instead (see models.ArtifactReference) - this is what lets pushing a fat manifest still
+// contribute to project quota. GetArtifactReferencesNotInProject reads that same table to find
+// the rows this sync still needs to create, so a child digest is never double-counted between
+// the two.
 func (info *ManifestInfo) SyncBlobs() error {
+	if info.IsIndex {
+		err := dao.SyncArtifactReferences(info.ProjectID, info.References)
+		if err == dao.ErrDupRows {
+			log.Warning("Some artifact references created by others, ignore this error")
+			return nil
+		}
+
+		return err
+	}
+
 	err := dao.SyncBlobs(info.References)
 	if err == dao.ErrDupRows {
 		log.Warning("Some blobs created by others, ignore this error")
@@ -188,6 +207,12 @@ func (info *ManifestInfo) SyncBlobs() error {
 
 // GetBlobsNotInProject returns blobs of the manifest which not in the project
 func (info *ManifestInfo) GetBlobsNotInProject() ([]*models.Blob, error) {
+	// A manifest list / OCI index has no blobs of its own: its children are manifests, counted
+	// by GetArtifactReferencesNotInProject instead.
+	if info.IsIndex {
+		return nil, nil
+	}
+
 	var digests []string
 	for _, reference := range info.References {
 		digests = append(digests, reference.Digest.String())
@@ -201,6 +226,27 @@ func (info *ManifestInfo) GetBlobsNotInProject() ([]*models.Blob, error) {
 	return blobs, nil
 }
 
+// GetArtifactReferencesNotInProject returns the artifact_reference rows for the child manifests
+// of a manifest list / OCI index that SyncBlobs hasn't created yet, so quota is only charged for
+// the children that are actually new.
+func (info *ManifestInfo) GetArtifactReferencesNotInProject() ([]*models.ArtifactReference, error) {
+	if !info.IsIndex {
+		return nil, nil
+	}
+
+	var digests []string
+	for _, reference := range info.References {
+		digests = append(digests, reference.Digest.String())
+	}
+
+	references, err := dao.GetArtifactReferencesNotInProject(info.ProjectID, digests...)
+	if err != nil {
+		return nil, err
+	}
+
+	return references, nil
+}
+
 func (info *ManifestInfo) fetchArtifact() (*models.Artifact, error) {
 	info.artifactOnce.Do(func() {
 		info.artifact, info.artifactErr = dao.GetArtifact(info.Repository, info.Tag)
@@ -218,12 +264,18 @@ func (info *ManifestInfo) IsNewTag() bool {
 
 // Artifact returns artifact of the manifest
 func (info *ManifestInfo) Artifact() *models.Artifact {
+	kind := "Docker-Image"
+	if info.IsIndex {
+		kind = "Docker-Image-Index"
+	}
+
 	result := &models.Artifact{
-		PID:    info.ProjectID,
-		Repo:   info.Repository,
-		Tag:    info.Tag,
-		Digest: info.Digest,
-		Kind:   "Docker-Image",
+		PID:        info.ProjectID,
+		Repo:       info.Repository,
+		Tag:        info.Tag,
+		Digest:     info.Digest,
+		Kind:       kind,
+		References: toArtifactReferences(info.References),
 	}
 
 	if artifact, _ := info.fetchArtifact(); artifact != nil {
@@ -235,6 +287,49 @@ func (info *ManifestInfo) Artifact() *models.Artifact {
 	return result
 }
 
+// toArtifactReferences converts the distribution.Descriptor references parsed off the wire into
+// the models.ArtifactReference rows persisted alongside the artifact, translating the OCI
+// Platform into Harbor's own models.Platform rather than persisting the vendored wire type.
+func toArtifactReferences(references []distribution.Descriptor) []models.ArtifactReference {
+	if len(references) == 0 {
+		return nil
+	}
+
+	out := make([]models.ArtifactReference, 0, len(references))
+	for _, ref := range references {
+		reference := models.ArtifactReference{
+			Digest:    ref.Digest.String(),
+			MediaType: ref.MediaType,
+			Size:      ref.Size,
+		}
+
+		if err := reference.SetPlatform(toModelsPlatform(ref.Platform)); err != nil {
+			log.Warningf("Error occurred when to marshal platform of %s: %v", ref.Digest, err)
+		}
+		if err := reference.SetAnnotations(ref.Annotations); err != nil {
+			log.Warningf("Error occurred when to marshal annotations of %s: %v", ref.Digest, err)
+		}
+
+		out = append(out, reference)
+	}
+
+	return out
+}
+
+func toModelsPlatform(p *ocispec.Platform) *models.Platform {
+	if p == nil {
+		return nil
+	}
+
+	return &models.Platform{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   p.OSFeatures,
+	}
+}
+
 // ManifestExists returns true if manifest exist in repository
 func (info *ManifestInfo) ManifestExists() (bool, error) {
 	info.manifestExistOnce.Do(func() {
@@ -465,11 +560,9 @@ func ParseManifestInfoFromReq(req *http.Request) (*ManifestInfo, error) {
 	}
 
 	mediaType := req.Header.Get("Content-Type")
-	if mediaType != schema1.MediaTypeManifest &&
-		mediaType != schema1.MediaTypeSignedManifest &&
-		mediaType != schema2.MediaTypeManifest &&
-		mediaType != ocispec.MediaTypeImageManifest {
-		return nil, fmt.Errorf("unsupported content type for manifest: %s", mediaType)
+	unmarshal, err := getManifestSchema(mediaType)
+	if err != nil {
+		return nil, err
 	}
 
 	if req.Body == nil {
@@ -483,35 +576,12 @@ func ParseManifestInfoFromReq(req *http.Request) (*ManifestInfo, error) {
 	}
 	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
-	var manifest ocispec.Manifest
-	err = json.Unmarshal(body, &manifest)
+	manifest, desc, err := unmarshal(body)
 	if err != nil {
-		log.Warningf("Error occurred when to Unmarshal OCI Manifest %v", err)
+		log.Warningf("Error occurred when to Unmarshal Manifest %v", err)
 		return nil, err
 	}
 
-	body, err = ioutil.ReadAll(req.Body)
-	if err != nil {
-		log.Warningf("Error occurred when to copy manifest body 2 %v", err)
-		return nil, err
-	}
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-
-	var desc ocispec.Descriptor
-	err = json.Unmarshal(body, &desc)
-	if err != nil {
-		log.Warningf("Error occurred when to Unmarshal OCI Descriptor %v", err)
-		return nil, err
-	}
-
-	/*
-		manifest, desc, err := distribution.UnmarshalManifest(mediaType, body)
-		if err != nil {
-			log.Warningf("Error occurred when to Unmarshal Manifest %v", err)
-			return nil, err
-		}
-	*/
-
 	projectName, _ := utils.ParseRepository(repository)
 	project, err := dao.GetProjectByName(projectName)
 	if err != nil {
@@ -521,33 +591,16 @@ func ParseManifestInfoFromReq(req *http.Request) (*ManifestInfo, error) {
 		return nil, fmt.Errorf("project %s not found", projectName)
 	}
 
-	references := []distribution.Descriptor{}
-	for _, layer := range manifest.Layers {
-		d := distribution.Descriptor{
-			MediaType:   layer.MediaType,
-			Size:        layer.Size,
-			Digest:      layer.Digest,
-			URLs:        layer.URLs,
-			Annotations: layer.Annotations,
-			Platform:    layer.Platform,
-		}
-		references = append(references, d)
-	}
+	_, isIndex := manifest.(*manifestlist.DeserializedManifestList)
 
 	return &ManifestInfo{
 		ProjectID:  project.ProjectID,
 		Repository: repository,
 		Tag:        tag,
 		Digest:     desc.Digest.String(),
-		References: references,
-		Descriptor: distribution.Descriptor{
-			MediaType:   desc.MediaType,
-			Size:        desc.Size,
-			Digest:      desc.Digest,
-			URLs:        desc.URLs,
-			Annotations: desc.Annotations,
-			Platform:    desc.Platform,
-		},
+		References: manifest.References(),
+		IsIndex:    isIndex,
+		Descriptor: desc,
 	}, nil
 }
 
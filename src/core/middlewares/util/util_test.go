@@ -0,0 +1,117 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManifestRequest(t *testing.T, reference, mediaType string, body []byte) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPut, "/v2/library/photon/manifests/"+reference, nil)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.Header.Set("Content-Type", mediaType)
+
+	return req
+}
+
+func TestParseManifestInfoFromReq_Schema2(t *testing.T) {
+	layer := distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromString("layer"), Size: 20}
+	manifest := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString("config"), Size: 10},
+		Layers:    []distribution.Descriptor{layer},
+	}
+	deserialized, err := schema2.FromStruct(manifest)
+	require.NoError(t, err)
+	_, body, err := deserialized.Payload()
+	require.NoError(t, err)
+
+	req := newManifestRequest(t, "latest", schema2.MediaTypeManifest, body)
+
+	info, err := ParseManifestInfoFromReq(req)
+	require.NoError(t, err)
+	assert.False(t, info.IsIndex)
+	// References lists the config descriptor first, then the layers.
+	require.Len(t, info.References, 2)
+	assert.Equal(t, layer.Digest, info.References[1].Digest)
+}
+
+func TestParseManifestInfoFromReq_ManifestList(t *testing.T) {
+	child := manifestlist.ManifestDescriptor{
+		Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: digest.FromString("child"), Size: 30},
+		Platform:   manifestlist.PlatformSpec{Architecture: "arm64", OS: "linux"},
+	}
+	deserialized, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{child})
+	require.NoError(t, err)
+	_, body, err := deserialized.Payload()
+	require.NoError(t, err)
+
+	req := newManifestRequest(t, "latest", manifestlist.MediaTypeManifestList, body)
+
+	info, err := ParseManifestInfoFromReq(req)
+	require.NoError(t, err)
+	assert.True(t, info.IsIndex)
+	require.Len(t, info.References, 1)
+	assert.Equal(t, child.Descriptor.Digest, info.References[0].Digest)
+	require.NotNil(t, info.References[0].Platform)
+	assert.Equal(t, "linux", info.References[0].Platform.OS)
+}
+
+func TestParseManifestInfoFromReq_OCIIndex(t *testing.T) {
+	type ociIndex struct {
+		SchemaVersion int                  `json:"schemaVersion"`
+		MediaType     string               `json:"mediaType,omitempty"`
+		Manifests     []ocispec.Descriptor `json:"manifests"`
+	}
+
+	idx := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{
+			{
+				MediaType: ocispec.MediaTypeImageManifest,
+				Digest:    digest.FromString("childindex"),
+				Size:      40,
+				Platform:  &ocispec.Platform{OS: "windows", Architecture: "amd64"},
+			},
+		},
+	}
+	body, err := json.Marshal(idx)
+	require.NoError(t, err)
+
+	req := newManifestRequest(t, "latest", ocispec.MediaTypeImageIndex, body)
+
+	info, err := ParseManifestInfoFromReq(req)
+	require.NoError(t, err)
+	assert.True(t, info.IsIndex)
+	require.Len(t, info.References, 1)
+	require.NotNil(t, info.References[0].Platform)
+	assert.Equal(t, "windows", info.References[0].Platform.OS)
+}